@@ -0,0 +1,57 @@
+package convnet
+
+// Backend performs the dense matrix-vector operations behind LayerFC's
+// forward and backward passes. The zero value of Net uses goBackend, a
+// plain Go implementation; NewNet lets a caller opt into an accelerated
+// one (see the blas build tag) via BackendOptions. Swapping backends must
+// not change a net's numerical results beyond floating-point rounding.
+type Backend interface {
+	// Dense computes y[i] = bias.W[i] + dot(weights[i].W, x) for every
+	// row i of weights. Every row of weights and x itself have the same
+	// length; y has one entry per row.
+	Dense(weights []*Vol, bias *Vol, x, y []float64)
+	// DenseBackward is the backward pass of Dense: given dy, the
+	// gradient on y, it accumulates weights[i].Dw and bias.Dw and adds
+	// the gradient on x into dx, which the caller has already zeroed.
+	DenseBackward(weights []*Vol, bias *Vol, x, dy, dx []float64)
+}
+
+// BackendOptions configures NewNet.
+type BackendOptions struct {
+	// Backend selects the linear-algebra implementation layers created
+	// by MakeLayers will use. nil, the default, uses the pure Go
+	// implementation.
+	Backend Backend
+}
+
+// NewNet returns an empty Net configured to build layers against
+// opts.Backend. Passing BackendOptions{} is equivalent to the zero value
+// &Net{}: both use the pure Go backend.
+func NewNet(opts BackendOptions) *Net {
+	return &Net{backend: opts.Backend}
+}
+
+// goBackend is the pure Go Backend every Net uses unless NewNet was given
+// a different one.
+type goBackend struct{}
+
+func (goBackend) Dense(weights []*Vol, bias *Vol, x, y []float64) {
+	for i, w := range weights {
+		var sum float64
+		for j, wij := range w.W {
+			sum += x[j] * wij
+		}
+		y[i] = sum + bias.W[i]
+	}
+}
+
+func (goBackend) DenseBackward(weights []*Vol, bias *Vol, x, dy, dx []float64) {
+	for i, w := range weights {
+		g := dy[i]
+		for j, wij := range w.W {
+			dx[j] += wij * g
+			w.Dw[j] += x[j] * g
+		}
+		bias.Dw[i] += g
+	}
+}
@@ -0,0 +1,65 @@
+//go:build blas
+
+package convnet
+
+import (
+	"gonum.org/v1/gonum/blas"
+	"gonum.org/v1/gonum/blas/blas64"
+)
+
+// NewBLASBackend returns a Backend that dispatches Dense and
+// DenseBackward through gonum.org/v1/gonum/blas64, so LayerFC's matrix
+// multiplies run against whatever blas64.Implementation is registered
+// (gonum's pure Go one by default; call blas64.Use with a cgo binding to
+// an OpenBLAS build for the accelerated path this backend exists for).
+// Only built with -tags blas, since most callers don't need the
+// dependency.
+func NewBLASBackend() Backend {
+	return blasBackend{}
+}
+
+type blasBackend struct{}
+
+func (blasBackend) Dense(weights []*Vol, bias *Vol, x, y []float64) {
+	m := len(weights)
+	if m == 0 {
+		return
+	}
+	n := len(x)
+
+	a := blas64.General{Rows: m, Cols: n, Stride: n, Data: make([]float64, m*n)}
+	for i, w := range weights {
+		copy(a.Data[i*n:(i+1)*n], w.W)
+	}
+
+	yVec := blas64.Vector{N: m, Inc: 1, Data: y}
+	copy(y, bias.W)
+	blas64.Implementation().Dgemv(blas.NoTrans, m, n, 1, a.Data, a.Stride, x, 1, 1, yVec.Data, yVec.Inc)
+}
+
+func (blasBackend) DenseBackward(weights []*Vol, bias *Vol, x, dy, dx []float64) {
+	m := len(weights)
+	if m == 0 {
+		return
+	}
+	n := len(x)
+
+	a := blas64.General{Rows: m, Cols: n, Stride: n, Data: make([]float64, m*n)}
+	for i, w := range weights {
+		copy(a.Data[i*n:(i+1)*n], w.W)
+	}
+
+	// dx += A^T * dy
+	blas64.Implementation().Dgemv(blas.Trans, m, n, 1, a.Data, a.Stride, dy, 1, 1, dx, 1)
+
+	// weights[i].Dw += dy[i] * x, bias.Dw += dy
+	dA := blas64.General{Rows: m, Cols: n, Stride: n, Data: make([]float64, m*n)}
+	blas64.Implementation().Dger(m, n, 1, dy, 1, x, 1, dA.Data, dA.Stride)
+	for i, w := range weights {
+		row := dA.Data[i*n : (i+1)*n]
+		for j := range w.Dw {
+			w.Dw[j] += row[j]
+		}
+		bias.Dw[i] += dy[i]
+	}
+}
@@ -0,0 +1,33 @@
+//go:build blas
+
+package convnet_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/BenLubar/convnet"
+)
+
+// it should compute correct gradients through the BLAS backend, checked
+// against numeric estimates the same way TestGradient checks the pure Go one
+func TestBLASBackendGradient(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	net := convnet.NewNet(convnet.BackendOptions{Backend: convnet.NewBLASBackend()})
+	net.MakeLayers([]convnet.LayerDef{
+		{Type: convnet.LayerInput, OutSx: 1, OutSy: 1, OutDepth: 2},
+		{Type: convnet.LayerFC, NumNeurons: 5, Activation: convnet.LayerTanh},
+		{Type: convnet.LayerFC, NumNeurons: 5, Activation: convnet.LayerTanh},
+		{Type: convnet.LayerSoftmax, NumClasses: 3},
+	}, r)
+
+	x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+	gti := r.Intn(3)
+
+	results := convnet.CheckGradients(net, x, convnet.LossData{Dim: gti}, convnet.CheckOptions{CheckParams: true})
+	for _, res := range results {
+		if !res.Pass {
+			t.Errorf("layer %d[%d]: rel error too high (%f)", res.Layer, res.Index, res.RelError)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package convnet_test
+
+import (
+	"testing"
+
+	"github.com/BenLubar/convnet"
+)
+
+// it should build and forward prop a net made with NewNet(BackendOptions{}),
+// which is just another way to spell the pure Go default the zero value
+// already uses
+func TestNewNetDefaultBackend(t *testing.T) {
+	net := convnet.NewNet(convnet.BackendOptions{})
+	net.MakeLayers([]convnet.LayerDef{
+		{Type: convnet.LayerInput, OutSx: 1, OutSy: 1, OutDepth: 2},
+		{Type: convnet.LayerFC, NumNeurons: 5, Activation: convnet.LayerTanh},
+		{Type: convnet.LayerSoftmax, NumClasses: 3},
+	}, nil)
+
+	if len(net.Layers) != 5 {
+		t.Fatalf("expected 5 layers, but there are %d", len(net.Layers))
+	}
+
+	x := convnet.NewVol1D([]float64{0.2, -0.3})
+	pv := net.Forward(x, false)
+	if len(pv.W) != 3 {
+		t.Errorf("expected probability_volume.W to have length 3, but length is %d", len(pv.W))
+	}
+}
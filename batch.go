@@ -0,0 +1,106 @@
+package convnet
+
+import (
+	"runtime"
+	"sync"
+)
+
+// TrainBatch runs every (xs[i], ys[i]) pair through the net, averages
+// their gradients, and applies a single parameter update - unlike Train,
+// which only updates every TrainerOptions.BatchSize calls, TrainBatch
+// always updates once per call regardless of TrainerOptions.BatchSize. It
+// returns the mean loss over the batch.
+func (t *Trainer) TrainBatch(xs []*Vol, ys []LossData) float64 {
+	var lossSum float64
+	for i, x := range xs {
+		lossSum += t.net.Backward(x, ys[i])
+	}
+
+	t.update(len(xs))
+	return lossSum / float64(len(xs))
+}
+
+// TrainSequence runs xs through the net's recurrent layers as one unrolled
+// sequence via Net.ForwardSequence, backpropagates-through-time with
+// Net.BackwardSequence, and applies a single parameter update from the
+// gradients accumulated across every timestep. It returns the total loss
+// over the sequence. Unlike TrainBatch, the examples are not independent:
+// call net.ResetState() first to start a fresh sequence, or leave it alone
+// to continue training on from the end of the previous one.
+func (t *Trainer) TrainSequence(xs []*Vol, ys []LossData) float64 {
+	t.net.ForwardSequence(xs)
+	loss := t.net.BackwardSequence(ys)
+
+	t.update(len(xs))
+	return loss
+}
+
+// TrainParallel is TrainBatch spread across runtime.NumCPU() goroutines:
+// the batch is split into contiguous shards, each run on a clone of the
+// net that shares the original's weights but keeps its own activations
+// and gradient accumulators, and the per-shard gradients are summed back
+// onto the real net before a single parameter update is applied. It
+// returns the mean loss over the batch.
+func (t *Trainer) TrainParallel(xs []*Vol, ys []LossData) float64 {
+	workers := runtime.NumCPU()
+	if workers > len(xs) {
+		workers = len(xs)
+	}
+	if workers <= 1 {
+		return t.TrainBatch(xs, ys)
+	}
+
+	shardLoss := make([]float64, workers)
+	clones := make([]*Net, workers)
+
+	var wg sync.WaitGroup
+	shardSize := (len(xs) + workers - 1) / workers
+	for w := 0; w < workers; w++ {
+		start, end := w*shardSize, (w+1)*shardSize
+		if end > len(xs) {
+			end = len(xs)
+		}
+		if start >= end {
+			continue
+		}
+
+		clone := t.net.cloneShared()
+		clones[w] = clone
+
+		wg.Add(1)
+		go func(w, start, end int) {
+			defer wg.Done()
+			for i := start; i < end; i++ {
+				shardLoss[w] += clone.Backward(xs[i], ys[i])
+			}
+		}(w, start, end)
+	}
+	wg.Wait()
+
+	all := t.paramsAndGrads()
+	var lossSum float64
+	for w, clone := range clones {
+		if clone == nil {
+			continue
+		}
+		lossSum += shardLoss[w]
+
+		cloneParams := paramsOfNet(clone)
+		for i, p := range cloneParams {
+			for j, dw := range p.Grads.Dw {
+				all[i].Grads.Dw[j] += dw
+			}
+		}
+	}
+
+	t.update(len(xs))
+	return lossSum / float64(len(xs))
+}
+
+func paramsOfNet(net *Net) []ParamsAndGrads {
+	var all []ParamsAndGrads
+	for _, l := range net.Layers {
+		all = append(all, paramsOf(l)...)
+	}
+	return all
+}
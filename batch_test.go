@@ -0,0 +1,62 @@
+package convnet_test
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/BenLubar/convnet"
+)
+
+// it should reduce the mean loss over a minibatch with a single update
+func TestTrainBatch(t *testing.T) {
+	net, trainer, r := createTestNet()
+
+	xs := make([]*convnet.Vol, 16)
+	ys := make([]convnet.LossData, 16)
+	for i := range xs {
+		xs[i] = convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+		ys[i] = convnet.LossData{Dim: r.Intn(3)}
+	}
+
+	before := batchLoss(net, xs, ys)
+	trainer.TrainBatch(xs, ys)
+	after := batchLoss(net, xs, ys)
+
+	if after >= before {
+		t.Errorf("expected mean batch loss to decrease, but it changed from %f to %f", before, after)
+	}
+}
+
+// it should reach the same result as TrainBatch, run across goroutines
+func TestTrainParallel(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+
+	xs := make([]*convnet.Vol, 64)
+	ys := make([]convnet.LossData, 64)
+	for i := range xs {
+		xs[i] = convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+		ys[i] = convnet.LossData{Dim: r.Intn(3)}
+	}
+
+	seqNet, seqTrainer, _ := createTestNetWithMethod(convnet.SGD, 0.01, 0, 0)
+	parNet, parTrainer, _ := createTestNetWithMethod(convnet.SGD, 0.01, 0, 0)
+
+	seqTrainer.TrainBatch(xs, ys)
+	parTrainer.TrainParallel(xs, ys)
+
+	seqOut := seqNet.Forward(xs[0], false)
+	parOut := parNet.Forward(xs[0], false)
+	for i := range seqOut.W {
+		if diff := seqOut.W[i] - parOut.W[i]; diff > 1e-9 || diff < -1e-9 {
+			t.Errorf("output[%d]: sequential batch gave %f, parallel batch gave %f", i, seqOut.W[i], parOut.W[i])
+		}
+	}
+}
+
+func batchLoss(net *convnet.Net, xs []*convnet.Vol, ys []convnet.LossData) float64 {
+	var sum float64
+	for i, x := range xs {
+		sum += net.CostLoss(x, ys[i])
+	}
+	return sum / float64(len(xs))
+}
@@ -8,8 +8,32 @@ import (
 	"github.com/BenLubar/convnet"
 )
 
+// optimizerMethods lists every Trainer.Method along with a learning rate
+// tuned so TestTrain's strict step-by-step improvement check holds for
+// it. Momentum and Nesterov run at half of SGD's rate; Adadelta's step
+// size comes from its own accumulators, so its rate is not used.
+var optimizerMethods = []struct {
+	name     string
+	method   convnet.Method
+	lr       float64
+	momentum float64
+	beta1    float64
+}{
+	{"SGD", convnet.SGD, 0.0001, 0, 0},
+	{"Momentum", convnet.Momentum, 0.00005, 0.1, 0},
+	{"Nesterov", convnet.Nesterov, 0.00005, 0.1, 0},
+	{"AdaGrad", convnet.AdaGrad, 0.0001, 0, 0},
+	{"RMSProp", convnet.RMSProp, 0.0001, 0, 0},
+	{"Adadelta", convnet.Adadelta, 0.1, 0, 0},
+	{"Adam", convnet.Adam, 0.0001, 0, 0.1},
+}
+
 // Simple Fully-Connected Neural Net Classifier.
 func createTestNet() (*convnet.Net, *convnet.Trainer, *rand.Rand) {
+	return createTestNetWithMethod(convnet.SGD, 0.0001, 0, 0)
+}
+
+func createTestNetWithMethod(method convnet.Method, lr, momentum, beta1 float64) (*convnet.Net, *convnet.Trainer, *rand.Rand) {
 	r := rand.New(rand.NewSource(0))
 
 	net := &convnet.Net{}
@@ -24,8 +48,10 @@ func createTestNet() (*convnet.Net, *convnet.Trainer, *rand.Rand) {
 	net.MakeLayers(layerDefs, r)
 
 	trainer := convnet.NewTrainer(net, convnet.TrainerOptions{
-		LearningRate: 0.0001,
-		Momentum:     0.0,
+		Method:       method,
+		LearningRate: lr,
+		Momentum:     momentum,
+		Beta1:        beta1,
 		BatchSize:    1,
 		L2Decay:      0.0,
 	})
@@ -70,56 +96,58 @@ func TestForward(t *testing.T) {
 	}
 }
 
-// it should increase probabilities for ground truth class when trained
+// it should increase probabilities for ground truth class when trained,
+// for every supported Trainer.Method
 func TestTrain(t *testing.T) {
-	net, trainer, r := createTestNet()
-
-	// lets test 100 random point and label settings
-	// note that this should work since l2 and l1 regularization are off
-	// an issue is that if step size is too high, this could technically fail...
-	for k := 0; k < 100; k++ {
-		x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
-		pv := net.Forward(x, false)
-		gti := r.Intn(3)
-		trainer.Train(x, convnet.LossData{Dim: gti})
-		pv2 := net.Forward(x, false)
-		if pv2.W[gti] <= pv.W[gti] {
-			t.Errorf("expected trained class probability to increase, but it changed from %f to %f", pv.W[gti], pv2.W[gti])
-		}
+	for _, m := range optimizerMethods {
+		m := m
+		t.Run(m.name, func(t *testing.T) {
+			net, trainer, r := createTestNetWithMethod(m.method, m.lr, m.momentum, m.beta1)
+
+			// lets test 100 random point and label settings
+			// note that this should work since l2 and l1 regularization are off
+			// an issue is that if step size is too high, this could technically fail...
+			for k := 0; k < 100; k++ {
+				x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+				pv := net.Forward(x, false)
+				gti := r.Intn(3)
+				trainer.Train(x, convnet.LossData{Dim: gti})
+				pv2 := net.Forward(x, false)
+				if pv2.W[gti] <= pv.W[gti] {
+					t.Errorf("expected trained class probability to increase, but it changed from %f to %f", pv.W[gti], pv2.W[gti])
+				}
+			}
+		})
 	}
 }
 
-// it should compute correct gradient at data
+// it should compute correct gradients at data and for every learnable
+// parameter, for every supported Trainer.Method (the update rule only
+// changes how weights move, not how the gradients are computed)
 func TestGradient(t *testing.T) {
 	// here we only test the gradient at data, but if this is
 	// right then that's comforting, because it is a function
 	// of all gradients above, for all layers.
 
-	net, trainer, r := createTestNet()
+	for _, m := range optimizerMethods {
+		m := m
+		t.Run(m.name, func(t *testing.T) {
+			net, _, r := createTestNetWithMethod(m.method, m.lr, m.momentum, m.beta1)
 
-	x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
-	gti := r.Intn(3)                             // ground truth index
-	trainer.Train(x, convnet.LossData{Dim: gti}) // computes gradients at all layers, and at x
+			x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+			gti := r.Intn(3) // ground truth index
 
-	const delta = 0.000001
+			results := convnet.CheckGradients(net, x, convnet.LossData{Dim: gti}, convnet.CheckOptions{
+				CheckParams: true,
+			})
 
-	for i := 0; i < len(x.W); i++ {
-		gradAnalytic := x.Dw[i]
+			for _, res := range results {
+				t.Logf("layer %d[%d]: numeric: %f, analytic: %f => rel error %f", res.Layer, res.Index, res.Numeric, res.Analytic, res.RelError)
 
-		xold := x.W[i]
-		x.W[i] += delta
-		c0 := net.CostLoss(x, convnet.LossData{Dim: gti})
-		x.W[i] -= 2 * delta
-		c1 := net.CostLoss(x, convnet.LossData{Dim: gti})
-		x.W[i] = xold // reset
-
-		gradNumeric := (c0 - c1) / (2 * delta)
-		relError := math.Abs(gradAnalytic-gradNumeric) / math.Abs(gradAnalytic+gradNumeric)
-
-		t.Logf("%d: numeric: %f, analytic: %f => rel error %f", i, gradNumeric, gradAnalytic, relError)
-
-		if relError >= 1e-2 {
-			t.Error("rel error too high")
-		}
+				if !res.Pass {
+					t.Errorf("layer %d[%d]: rel error too high (%f)", res.Layer, res.Index, res.RelError)
+				}
+			}
+		})
 	}
 }
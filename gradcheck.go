@@ -0,0 +1,104 @@
+package convnet
+
+import "math"
+
+// CheckOptions configures CheckGradients.
+type CheckOptions struct {
+	// Delta is the finite-difference step used to estimate each
+	// numerical gradient. Zero means 1e-6.
+	Delta float64
+	// Tolerance is the relative error above which a GradCheckResult is
+	// considered failing. Zero means 1e-2.
+	Tolerance float64
+	// CheckParams additionally verifies every learnable parameter
+	// returned by net.ParamsAndGrads(), not just the gradient at x.
+	CheckParams bool
+}
+
+// GradCheckResult reports the analytic vs. numeric gradient found for one
+// scalar weight. Layer is the index into net.Layers the weight belongs
+// to, or -1 if it is a component of x rather than a layer parameter; Index
+// is the position of the weight within that parameter's W slice.
+type GradCheckResult struct {
+	Layer    int
+	Index    int
+	Analytic float64
+	Numeric  float64
+	RelError float64
+	Pass     bool
+}
+
+// CheckGradients numerically verifies the analytic gradients Backward
+// computes for x (and, if opts.CheckParams is set, for every learnable
+// parameter in net) against a symmetric finite-difference estimate. It is
+// the check TestGradient has always run made available for callers to run
+// against their own nets, e.g. after adding a new layer type, to localize
+// exploding or vanishing gradients to the layer/parameter that produced
+// them.
+func CheckGradients(net *Net, x *Vol, loss LossData, opts CheckOptions) []GradCheckResult {
+	delta := opts.Delta
+	if delta == 0 {
+		delta = 1e-6
+	}
+	tolerance := opts.Tolerance
+	if tolerance == 0 {
+		tolerance = 1e-2
+	}
+
+	net.ResetState()
+	net.Backward(x, loss)
+
+	var results []GradCheckResult
+
+	results = append(results, checkVol(net, x, loss, -1, x, delta, tolerance)...)
+
+	if opts.CheckParams {
+		for li, l := range net.Layers {
+			for _, p := range paramsOf(l) {
+				results = append(results, checkVol(net, x, loss, li, p.Params, delta, tolerance)...)
+			}
+		}
+	}
+
+	return results
+}
+
+// checkVol estimates the numerical gradient of each weight in v (whose
+// analytic gradient is assumed to already be populated in v.Dw by a prior
+// Backward) by symmetric finite differences on the net's cost. It resets
+// any recurrent layer's hidden state before every probe, since a CostLoss
+// call is otherwise not pure: Forward always advances hidden state,
+// analytic or not, which would otherwise make each successive probe see a
+// different starting state than the one the analytic gradient was taken
+// against.
+func checkVol(net *Net, x *Vol, loss LossData, layer int, v *Vol, delta, tolerance float64) []GradCheckResult {
+	results := make([]GradCheckResult, len(v.W))
+
+	for i := range v.W {
+		analytic := v.Dw[i]
+
+		old := v.W[i]
+		v.W[i] = old + delta
+		net.ResetState()
+		c0 := net.CostLoss(x, loss)
+		v.W[i] = old - delta
+		net.ResetState()
+		c1 := net.CostLoss(x, loss)
+		v.W[i] = old
+		net.ResetState()
+
+		numeric := (c0 - c1) / (2 * delta)
+		relError := math.Abs(analytic-numeric) / math.Max(math.Abs(analytic)+math.Abs(numeric), 1e-8)
+
+		results[i] = GradCheckResult{
+			Layer:    layer,
+			Index:    i,
+			Analytic: analytic,
+			Numeric:  numeric,
+			RelError: relError,
+			Pass:     relError < tolerance,
+		}
+	}
+
+	return results
+}
@@ -0,0 +1,401 @@
+package convnet
+
+import (
+	"math"
+	"math/rand"
+)
+
+// LayerType identifies the kind of a Layer or the sugar a LayerDef
+// desugars into. See MakeLayers.
+type LayerType int
+
+// The layer types a LayerDef may request.
+const (
+	LayerInput LayerType = iota
+	LayerFC
+	LayerTanh
+	LayerRelu
+	LayerSigmoid
+	LayerSoftmax
+	LayerRNN
+	LayerGRU
+	LayerLSTM
+)
+
+// LayerDef describes one entry in the stack passed to (*Net).MakeLayers.
+// Some types are sugar: a LayerFC or LayerSoftmax def also implies an
+// Activation or an implicit fully-connected layer feeding it, and
+// MakeLayers expands those into multiple concrete Layers.
+type LayerDef struct {
+	Type LayerType
+
+	OutSx, OutSy, OutDepth int
+
+	NumNeurons int
+	Activation LayerType
+
+	NumClasses int
+
+	// HiddenSize is the number of hidden units for a LayerRNN, LayerGRU,
+	// or LayerLSTM.
+	HiddenSize int
+
+	L1DecayMul, L2DecayMul float64
+}
+
+// ParamsAndGrads pairs a learnable parameter volume with the per-parameter
+// regularization multipliers the Trainer should apply to it.
+type ParamsAndGrads struct {
+	Params, Grads          *Vol
+	L1DecayMul, L2DecayMul float64
+}
+
+// Layer is implemented by every concrete layer a Net can be made of.
+type Layer interface {
+	// Type returns the concrete kind of this layer.
+	Type() LayerType
+	// OutputShape returns the Sx, Sy, Depth of volumes this layer produces.
+	OutputShape() (sx, sy, depth int)
+	// Forward computes this layer's output volume from in. isTraining is
+	// false at test time, which disables any training-only noise (e.g.
+	// dropout, once added).
+	Forward(in *Vol, isTraining bool) *Vol
+	// Backward propagates the gradient on this layer's output volume
+	// back onto its input volume's Dw.
+	Backward()
+}
+
+// lossLayer is implemented by the final layer of a net, which turns an
+// input volume plus ground truth into a loss and a gradient.
+type lossLayer interface {
+	Layer
+	BackwardLoss(y LossData) float64
+	// lossOnly computes the loss for y against the layer's last Forward
+	// output without touching any Dw, so CostLoss can probe the cost
+	// surface without disturbing gradients from a real Backward pass.
+	lossOnly(y LossData) float64
+}
+
+// LossData carries the ground truth for the final layer of a net. Dim is
+// the target class index for a softmax/classifier output.
+type LossData struct {
+	Dim int
+}
+
+// sharedCloner is implemented by every Layer. cloneShared returns a copy
+// that aliases any learnable weights but owns independent activation and
+// gradient state, so the clone can run Forward/Backward concurrently with
+// the original (or other clones) from a different goroutine.
+type sharedCloner interface {
+	cloneShared() Layer
+}
+
+// stepCache is implemented by every Layer so Net.ForwardSequence and
+// Net.BackwardSequence can replay a whole timestep's worth of layers in
+// reverse order during backprop-through-time. pushState snapshots whatever
+// per-step fields Backward reads (inAct, outAct, and any recurrent state)
+// onto an internal stack; popState restores the most recently pushed
+// snapshot that hasn't been popped yet, in last-in-first-out order, which
+// is exactly the order BackwardSequence visits timesteps in.
+type stepCache interface {
+	pushState()
+	popState()
+}
+
+// recurrentLayer is implemented by LayerRNN, LayerGRU, and LayerLSTM. Their
+// hidden (and, for LSTM, cell) state persists across Forward calls so a
+// sequence of Forward calls behaves as one unrolled recurrence; ResetState
+// clears that state so the next Forward starts a fresh sequence.
+type recurrentLayer interface {
+	Layer
+	ResetState()
+}
+
+// bpttResetter is implemented by recurrent layers in addition to
+// recurrentLayer. It clears the gradient a layer has been accumulating
+// against its own previous hidden state, without touching the persisted
+// hidden state itself, so BackwardSequence can start a fresh backward pass
+// over a sequence whose hidden state should carry on to the next one.
+type bpttResetter interface {
+	resetBPTT()
+}
+
+func paramsOf(l Layer) []ParamsAndGrads {
+	if lp, ok := l.(learnable); ok {
+		return lp.ParamsAndGrads()
+	}
+	return nil
+}
+
+// inputLayer simply passes its input through; it exists to give the first
+// entry in Net.Layers a well-defined output shape.
+type inputLayer struct {
+	outSx, outSy, outDepth int
+	inAct                  *Vol
+
+	history []*Vol
+}
+
+func newInputLayer(def LayerDef) *inputLayer {
+	return &inputLayer{outSx: def.OutSx, outSy: def.OutSy, outDepth: def.OutDepth}
+}
+
+func (l *inputLayer) Type() LayerType                       { return LayerInput }
+func (l *inputLayer) OutputShape() (int, int, int)          { return l.outSx, l.outSy, l.outDepth }
+func (l *inputLayer) Forward(in *Vol, isTraining bool) *Vol { l.inAct = in; return in }
+func (l *inputLayer) Backward()                             {}
+
+func (l *inputLayer) cloneShared() Layer {
+	return &inputLayer{outSx: l.outSx, outSy: l.outSy, outDepth: l.outDepth}
+}
+
+func (l *inputLayer) pushState() { l.history = append(l.history, l.inAct) }
+func (l *inputLayer) popState() {
+	n := len(l.history) - 1
+	l.inAct = l.history[n]
+	l.history = l.history[:n]
+}
+
+// fcLayer is a fully-connected layer: every output neuron is a weighted
+// sum of every input activation plus a bias.
+type fcLayer struct {
+	numNeurons             int
+	inSx, inSy, inDepth    int
+	l1DecayMul, l2DecayMul float64
+
+	filters []*Vol
+	biases  *Vol
+	backend Backend
+
+	inAct, outAct *Vol
+
+	history []ioState
+}
+
+type ioState struct {
+	inAct, outAct *Vol
+}
+
+func newFCLayer(def LayerDef, backend Backend, r *rand.Rand) *fcLayer {
+	if r == nil {
+		r = rand.New(rand.NewSource(0))
+	}
+	if backend == nil {
+		backend = goBackend{}
+	}
+	l := &fcLayer{
+		numNeurons: def.NumNeurons,
+		inSx:       def.OutSx, inSy: def.OutSy, inDepth: def.OutDepth,
+		l1DecayMul: def.L1DecayMul, l2DecayMul: def.L2DecayMul,
+		backend: backend,
+	}
+	if l.l2DecayMul == 0 {
+		l.l2DecayMul = 1
+	}
+	numInputs := def.OutSx * def.OutSy * def.OutDepth
+	std := math.Sqrt(2.0 / float64(numInputs))
+	l.filters = make([]*Vol, l.numNeurons)
+	for i := range l.filters {
+		l.filters[i] = NewVolRand(1, 1, numInputs, std, r)
+	}
+	l.biases = NewVol(1, 1, l.numNeurons, 0)
+	return l
+}
+
+func (l *fcLayer) Type() LayerType              { return LayerFC }
+func (l *fcLayer) OutputShape() (int, int, int) { return 1, 1, l.numNeurons }
+
+func (l *fcLayer) Forward(in *Vol, isTraining bool) *Vol {
+	l.inAct = in
+	out := NewVol(1, 1, l.numNeurons, 0)
+	l.backend.Dense(l.filters, l.biases, in.W, out.W)
+	l.outAct = out
+	return out
+}
+
+func (l *fcLayer) Backward() {
+	in := l.inAct
+	in.ZeroGrads()
+	l.backend.DenseBackward(l.filters, l.biases, in.W, l.outAct.Dw, in.Dw)
+}
+
+func (l *fcLayer) ParamsAndGrads() []ParamsAndGrads {
+	pg := make([]ParamsAndGrads, 0, len(l.filters)+1)
+	for _, f := range l.filters {
+		pg = append(pg, ParamsAndGrads{Params: f, Grads: f, L1DecayMul: l.l1DecayMul, L2DecayMul: l.l2DecayMul})
+	}
+	pg = append(pg, ParamsAndGrads{Params: l.biases, Grads: l.biases, L1DecayMul: 0, L2DecayMul: 0})
+	return pg
+}
+
+// cloneShared returns an *fcLayer that aliases this layer's weights but
+// has independent activation and gradient state, safe to run concurrently
+// with the original from a different goroutine. See TrainParallel.
+func (l *fcLayer) cloneShared() Layer {
+	clone := &fcLayer{
+		numNeurons: l.numNeurons,
+		inSx:       l.inSx, inSy: l.inSy, inDepth: l.inDepth,
+		l1DecayMul: l.l1DecayMul, l2DecayMul: l.l2DecayMul,
+		filters: make([]*Vol, len(l.filters)),
+		biases:  l.biases.CloneShared(),
+		backend: l.backend,
+	}
+	for i, f := range l.filters {
+		clone.filters[i] = f.CloneShared()
+	}
+	return clone
+}
+
+func (l *fcLayer) pushState() {
+	l.history = append(l.history, ioState{inAct: l.inAct, outAct: l.outAct})
+}
+
+func (l *fcLayer) popState() {
+	n := len(l.history) - 1
+	l.inAct, l.outAct = l.history[n].inAct, l.history[n].outAct
+	l.history = l.history[:n]
+}
+
+// activationLayer applies an elementwise nonlinearity and its derivative.
+type activationLayer struct {
+	kind          LayerType
+	fn, deriv     func(float64) float64
+	sx, sy, depth int
+	inAct, outAct *Vol
+
+	history []ioState
+}
+
+func newActivationLayer(kind LayerType, sx, sy, depth int) *activationLayer {
+	l := &activationLayer{kind: kind, sx: sx, sy: sy, depth: depth}
+	switch kind {
+	case LayerTanh:
+		l.fn = math.Tanh
+		l.deriv = func(y float64) float64 { return 1 - y*y }
+	case LayerSigmoid:
+		l.fn = func(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+		l.deriv = func(y float64) float64 { return y * (1 - y) }
+	case LayerRelu:
+		l.fn = func(x float64) float64 {
+			if x < 0 {
+				return 0
+			}
+			return x
+		}
+		l.deriv = func(y float64) float64 {
+			if y <= 0 {
+				return 0
+			}
+			return 1
+		}
+	}
+	return l
+}
+
+func (l *activationLayer) Type() LayerType              { return l.kind }
+func (l *activationLayer) OutputShape() (int, int, int) { return l.sx, l.sy, l.depth }
+
+func (l *activationLayer) Forward(in *Vol, isTraining bool) *Vol {
+	l.inAct = in
+	out := NewVol(l.sx, l.sy, l.depth, 0)
+	for i, x := range in.W {
+		out.W[i] = l.fn(x)
+	}
+	l.outAct = out
+	return out
+}
+
+func (l *activationLayer) Backward() {
+	in := l.inAct
+	in.ZeroGrads()
+	for i := range in.W {
+		in.Dw[i] = l.deriv(l.outAct.W[i]) * l.outAct.Dw[i]
+	}
+}
+
+func (l *activationLayer) cloneShared() Layer {
+	return newActivationLayer(l.kind, l.sx, l.sy, l.depth)
+}
+
+func (l *activationLayer) pushState() {
+	l.history = append(l.history, ioState{inAct: l.inAct, outAct: l.outAct})
+}
+
+func (l *activationLayer) popState() {
+	n := len(l.history) - 1
+	l.inAct, l.outAct = l.history[n].inAct, l.history[n].outAct
+	l.history = l.history[:n]
+}
+
+// softmaxLayer turns its input into a probability distribution and, given
+// ground truth, the cross-entropy loss and its gradient.
+type softmaxLayer struct {
+	numClasses    int
+	inAct, outAct *Vol
+
+	history []ioState
+}
+
+func newSoftmaxLayer(numClasses int) *softmaxLayer {
+	return &softmaxLayer{numClasses: numClasses}
+}
+
+func (l *softmaxLayer) Type() LayerType              { return LayerSoftmax }
+func (l *softmaxLayer) OutputShape() (int, int, int) { return 1, 1, l.numClasses }
+
+func (l *softmaxLayer) Forward(in *Vol, isTraining bool) *Vol {
+	l.inAct = in
+
+	max := in.W[0]
+	for _, x := range in.W {
+		if x > max {
+			max = x
+		}
+	}
+	exps := make([]float64, len(in.W))
+	var sum float64
+	for i, x := range in.W {
+		e := math.Exp(x - max)
+		exps[i] = e
+		sum += e
+	}
+	out := NewVol(1, 1, l.numClasses, 0)
+	for i, e := range exps {
+		out.W[i] = e / sum
+	}
+	l.outAct = out
+	return out
+}
+
+func (l *softmaxLayer) Backward() {}
+
+func (l *softmaxLayer) cloneShared() Layer {
+	return newSoftmaxLayer(l.numClasses)
+}
+
+func (l *softmaxLayer) BackwardLoss(y LossData) float64 {
+	in := l.inAct
+	in.ZeroGrads()
+	for i, p := range l.outAct.W {
+		indicator := 0.0
+		if i == y.Dim {
+			indicator = 1
+		}
+		in.Dw[i] = p - indicator
+	}
+	return -math.Log(l.outAct.W[y.Dim])
+}
+
+func (l *softmaxLayer) lossOnly(y LossData) float64 {
+	return -math.Log(l.outAct.W[y.Dim])
+}
+
+func (l *softmaxLayer) pushState() {
+	l.history = append(l.history, ioState{inAct: l.inAct, outAct: l.outAct})
+}
+
+func (l *softmaxLayer) popState() {
+	n := len(l.history) - 1
+	l.inAct, l.outAct = l.history[n].inAct, l.history[n].outAct
+	l.history = l.history[:n]
+}
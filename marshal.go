@@ -0,0 +1,234 @@
+package convnet
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// jsonLayer mirrors the shape of a single entry in the "layers" array of a
+// ConvNetJS JSON model, so nets trained here can be loaded by (and nets
+// exported from) the browser-side library without a conversion step.
+type jsonLayer struct {
+	LayerType string `json:"layer_type"`
+
+	OutSx    int `json:"out_sx"`
+	OutSy    int `json:"out_sy"`
+	OutDepth int `json:"out_depth"`
+
+	NumNeurons int `json:"num_neurons,omitempty"`
+	NumClasses int `json:"num_classes,omitempty"`
+	InSx       int `json:"in_sx,omitempty"`
+	InSy       int `json:"in_sy,omitempty"`
+	InDepth    int `json:"in_depth,omitempty"`
+
+	HiddenSize int `json:"hidden_size,omitempty"`
+
+	L1DecayMul float64 `json:"l1_decay_mul,omitempty"`
+	L2DecayMul float64 `json:"l2_decay_mul,omitempty"`
+
+	Filters []jsonVol `json:"filters,omitempty"`
+	Biases  *jsonVol  `json:"biases,omitempty"`
+}
+
+// jsonVol mirrors ConvNetJS's {sx, sy, depth, w} volume encoding.
+type jsonVol struct {
+	Sx    int       `json:"sx"`
+	Sy    int       `json:"sy"`
+	Depth int       `json:"depth"`
+	W     []float64 `json:"w"`
+}
+
+// jsonNet is the top-level {"layers": [...]} document.
+type jsonNet struct {
+	Layers []jsonLayer `json:"layers"`
+}
+
+// MarshalJSON encodes net in the same layer-by-layer schema used by
+// ConvNetJS's net.toJSON(), including learned weights and biases, so the
+// result can be handed to a browser-side ConvNetJS without translation.
+func (net *Net) MarshalJSON() ([]byte, error) {
+	doc := jsonNet{Layers: make([]jsonLayer, len(net.Layers))}
+	for i, l := range net.Layers {
+		doc.Layers[i] = layerToJSON(l)
+	}
+	return json.Marshal(doc)
+}
+
+// UnmarshalJSON reconstructs net's layer stack, the same way MakeLayers
+// builds a Net from a sugared []LayerDef, and then overlays the learned
+// weights found in data. It is the inverse of MarshalJSON. Unlike
+// MakeLayers, the JSON already lists every concrete layer (ConvNetJS
+// never sugars FC+activation or the implicit softmax classifier away in
+// its own toJSON), so no desugaring is needed here.
+func (net *Net) UnmarshalJSON(data []byte) error {
+	var doc jsonNet
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	layers := make([]Layer, len(doc.Layers))
+	for i, jl := range doc.Layers {
+		l, err := layerFromJSON(jl)
+		if err != nil {
+			return err
+		}
+		layers[i] = l
+	}
+	net.Layers = layers
+
+	for i, jl := range doc.Layers {
+		applyJSONWeights(net.Layers[i], jl)
+	}
+	return nil
+}
+
+// LoadFromJSON is a convenience wrapper around UnmarshalJSON that decodes
+// data into a newly allocated *Net and returns it.
+func LoadFromJSON(data []byte) (*Net, error) {
+	net := &Net{}
+	if err := net.UnmarshalJSON(data); err != nil {
+		return nil, err
+	}
+	return net, nil
+}
+
+// layerTypeNames mirrors the lowercase "layer_type" strings ConvNetJS uses
+// in its JSON models. rnn, gru, and lstm have no ConvNetJS equivalent; they
+// are this package's own extension to the schema.
+var layerTypeNames = map[LayerType]string{
+	LayerInput:   "input",
+	LayerFC:      "fc",
+	LayerTanh:    "tanh",
+	LayerRelu:    "relu",
+	LayerSigmoid: "sigmoid",
+	LayerSoftmax: "softmax",
+	LayerRNN:     "rnn",
+	LayerGRU:     "gru",
+	LayerLSTM:    "lstm",
+}
+
+// String returns the ConvNetJS-compatible name for t, or "" if t is not a
+// type MarshalJSON knows how to export.
+func (t LayerType) String() string {
+	return layerTypeNames[t]
+}
+
+func layerTypeFromString(s string) LayerType {
+	for t, name := range layerTypeNames {
+		if name == s {
+			return t
+		}
+	}
+	return -1
+}
+
+func volToJSON(v *Vol) jsonVol {
+	return jsonVol{Sx: v.Sx, Sy: v.Sy, Depth: v.Depth, W: v.W}
+}
+
+func jsonToVol(jv jsonVol) *Vol {
+	v := NewVol(jv.Sx, jv.Sy, jv.Depth, 0)
+	copy(v.W, jv.W)
+	return v
+}
+
+func layerToJSON(l Layer) jsonLayer {
+	sx, sy, depth := l.OutputShape()
+	jl := jsonLayer{
+		LayerType: l.Type().String(),
+		OutSx:     sx,
+		OutSy:     sy,
+		OutDepth:  depth,
+	}
+
+	switch t := l.(type) {
+	case *fcLayer:
+		jl.NumNeurons = t.numNeurons
+		jl.InSx, jl.InSy, jl.InDepth = t.inSx, t.inSy, t.inDepth
+	case *softmaxLayer:
+		jl.NumClasses = t.numClasses
+	case *rnnLayer:
+		jl.HiddenSize = t.hiddenSize
+		jl.InSx, jl.InSy, jl.InDepth = t.inSx, t.inSy, t.inDepth
+	case *gruLayer:
+		jl.HiddenSize = t.hiddenSize
+		jl.InSx, jl.InSy, jl.InDepth = t.inSx, t.inSy, t.inDepth
+	case *lstmLayer:
+		jl.HiddenSize = t.hiddenSize
+		jl.InSx, jl.InSy, jl.InDepth = t.inSx, t.inSy, t.inDepth
+	}
+
+	pg, ok := l.(learnable)
+	if !ok {
+		return jl
+	}
+	params := pg.ParamsAndGrads()
+	if _, ok := l.(*fcLayer); ok {
+		// fcLayer.ParamsAndGrads appends the shared bias vol last;
+		// ConvNetJS keeps it out of "filters" and in its own "biases"
+		// field, so split it back out here.
+		params, biases := params[:len(params)-1], params[len(params)-1]
+		jv := volToJSON(biases.Params)
+		jl.Biases = &jv
+		for _, p := range params {
+			jl.Filters = append(jl.Filters, volToJSON(p.Params))
+		}
+		return jl
+	}
+	for _, p := range params {
+		jl.Filters = append(jl.Filters, volToJSON(p.Params))
+	}
+	return jl
+}
+
+// layerFromJSON builds the concrete layer jl describes. It does not fill
+// in learned weights; call applyJSONWeights afterwards for that.
+func layerFromJSON(jl jsonLayer) (Layer, error) {
+	switch layerTypeFromString(jl.LayerType) {
+	case LayerInput:
+		return newInputLayer(LayerDef{OutSx: jl.OutSx, OutSy: jl.OutSy, OutDepth: jl.OutDepth}), nil
+	case LayerFC:
+		return newFCLayer(LayerDef{Type: LayerFC, OutSx: jl.InSx, OutSy: jl.InSy, OutDepth: jl.InDepth, NumNeurons: jl.NumNeurons}, nil, nil), nil
+	case LayerTanh, LayerRelu, LayerSigmoid:
+		return newActivationLayer(layerTypeFromString(jl.LayerType), jl.OutSx, jl.OutSy, jl.OutDepth), nil
+	case LayerSoftmax:
+		return newSoftmaxLayer(jl.NumClasses), nil
+	case LayerRNN:
+		return newRNNLayer(LayerDef{OutSx: jl.InSx, OutSy: jl.InSy, OutDepth: jl.InDepth, HiddenSize: jl.HiddenSize}, nil), nil
+	case LayerGRU:
+		return newGRULayer(LayerDef{OutSx: jl.InSx, OutSy: jl.InSy, OutDepth: jl.InDepth, HiddenSize: jl.HiddenSize}, nil), nil
+	case LayerLSTM:
+		return newLSTMLayer(LayerDef{OutSx: jl.InSx, OutSy: jl.InSy, OutDepth: jl.InDepth, HiddenSize: jl.HiddenSize}, nil), nil
+	default:
+		return nil, fmt.Errorf("convnet: unknown layer_type %q", jl.LayerType)
+	}
+}
+
+func applyJSONWeights(l Layer, jl jsonLayer) {
+	pg, ok := l.(learnable)
+	if !ok {
+		return
+	}
+	params := pg.ParamsAndGrads()
+	if _, ok := l.(*fcLayer); ok {
+		// Mirror the filters/biases split layerToJSON makes: the bias
+		// vol is ParamsAndGrads' last entry but jl's own field.
+		params, biases := params[:len(params)-1], params[len(params)-1]
+		if jl.Biases != nil {
+			copy(biases.Params.W, jl.Biases.W)
+		}
+		for i, p := range params {
+			if i >= len(jl.Filters) {
+				break
+			}
+			copy(p.Params.W, jl.Filters[i].W)
+		}
+		return
+	}
+	for i, p := range params {
+		if i >= len(jl.Filters) {
+			break
+		}
+		copy(p.Params.W, jl.Filters[i].W)
+	}
+}
@@ -0,0 +1,196 @@
+package convnet
+
+import "math/rand"
+
+// Net is a stack of Layers. The zero value is an empty net; use MakeLayers
+// to build one from a []LayerDef. Use NewNet instead of the zero value to
+// select a non-default Backend for the dense layers MakeLayers creates.
+type Net struct {
+	Layers []Layer
+
+	backend Backend
+}
+
+// MakeLayers replaces net.Layers with the concrete layers described by
+// defs, desugaring each LayerFC's Activation into a separate activation
+// layer and each LayerSoftmax into an implicit fully-connected layer
+// feeding a softmax, the same way ConvNetJS's net.makeLayers does. r
+// supplies the randomness used to initialize learnable weights; it may be
+// nil when the weights will be overwritten immediately afterwards (as
+// Load and UnmarshalJSON do).
+func (net *Net) MakeLayers(defs []LayerDef, r *rand.Rand) {
+	if r == nil {
+		r = rand.New(rand.NewSource(0))
+	}
+
+	var layers []Layer
+	var sx, sy, depth int
+
+	for _, def := range defs {
+		switch def.Type {
+		case LayerInput:
+			l := newInputLayer(def)
+			sx, sy, depth = l.OutputShape()
+			layers = append(layers, l)
+
+		case LayerFC:
+			fc := newFCLayer(LayerDef{
+				Type: LayerFC, OutSx: sx, OutSy: sy, OutDepth: depth,
+				NumNeurons: def.NumNeurons,
+				L1DecayMul: def.L1DecayMul, L2DecayMul: def.L2DecayMul,
+			}, net.backend, r)
+			sx, sy, depth = fc.OutputShape()
+			layers = append(layers, fc)
+
+			if def.Activation == LayerTanh || def.Activation == LayerRelu || def.Activation == LayerSigmoid {
+				act := newActivationLayer(def.Activation, sx, sy, depth)
+				sx, sy, depth = act.OutputShape()
+				layers = append(layers, act)
+			}
+
+		case LayerSoftmax:
+			fc := newFCLayer(LayerDef{Type: LayerFC, OutSx: sx, OutSy: sy, OutDepth: depth, NumNeurons: def.NumClasses}, net.backend, r)
+			layers = append(layers, fc)
+
+			sm := newSoftmaxLayer(def.NumClasses)
+			sx, sy, depth = sm.OutputShape()
+			layers = append(layers, sm)
+
+		case LayerRNN:
+			rnn := newRNNLayer(LayerDef{OutSx: sx, OutSy: sy, OutDepth: depth, HiddenSize: def.HiddenSize, L1DecayMul: def.L1DecayMul, L2DecayMul: def.L2DecayMul}, r)
+			sx, sy, depth = rnn.OutputShape()
+			layers = append(layers, rnn)
+
+		case LayerGRU:
+			gru := newGRULayer(LayerDef{OutSx: sx, OutSy: sy, OutDepth: depth, HiddenSize: def.HiddenSize, L1DecayMul: def.L1DecayMul, L2DecayMul: def.L2DecayMul}, r)
+			sx, sy, depth = gru.OutputShape()
+			layers = append(layers, gru)
+
+		case LayerLSTM:
+			lstm := newLSTMLayer(LayerDef{OutSx: sx, OutSy: sy, OutDepth: depth, HiddenSize: def.HiddenSize, L1DecayMul: def.L1DecayMul, L2DecayMul: def.L2DecayMul}, r)
+			sx, sy, depth = lstm.OutputShape()
+			layers = append(layers, lstm)
+		}
+	}
+
+	net.Layers = layers
+}
+
+// Forward runs x through every layer in order and returns the final
+// layer's output volume. isTraining is threaded through to layers (such
+// as dropout, once added) that behave differently at train and test time.
+func (net *Net) Forward(x *Vol, isTraining bool) *Vol {
+	act := x
+	for _, l := range net.Layers {
+		act = l.Forward(act, isTraining)
+	}
+	return act
+}
+
+// Backward runs Forward(x, true) and then backpropagates the loss for y
+// through every layer, leaving each parameter's Dw populated with the
+// gradient of the loss with respect to it. It returns the loss.
+func (net *Net) Backward(x *Vol, y LossData) float64 {
+	net.Forward(x, true)
+
+	for _, l := range net.Layers {
+		if r, ok := l.(bpttResetter); ok {
+			r.resetBPTT()
+		}
+	}
+
+	last := net.Layers[len(net.Layers)-1].(lossLayer)
+	loss := last.BackwardLoss(y)
+
+	for i := len(net.Layers) - 2; i >= 0; i-- {
+		net.Layers[i].Backward()
+	}
+	return loss
+}
+
+// ParamsAndGrads returns every learnable parameter volume in the net,
+// across all layers, paired with the regularization multipliers the
+// Trainer should apply to it. Layers without learnable parameters (such
+// as LayerInput or an activation) contribute nothing.
+func (net *Net) ParamsAndGrads() []ParamsAndGrads {
+	return paramsOfNet(net)
+}
+
+// cloneShared returns a Net whose layers alias this net's learnable
+// weights but have independent activation and gradient state, so the
+// clone's Forward/Backward can run concurrently with the original (or
+// other clones) from a different goroutine. See Trainer.TrainParallel.
+func (net *Net) cloneShared() *Net {
+	clone := &Net{Layers: make([]Layer, len(net.Layers))}
+	for i, l := range net.Layers {
+		clone.Layers[i] = l.(sharedCloner).cloneShared()
+	}
+	return clone
+}
+
+// CostLoss runs x through the net and returns the loss against y without
+// touching any gradients; it is the building block gradient checks use to
+// numerically estimate a derivative.
+func (net *Net) CostLoss(x *Vol, y LossData) float64 {
+	net.Forward(x, false)
+	last := net.Layers[len(net.Layers)-1].(lossLayer)
+	return last.lossOnly(y)
+}
+
+// ForwardSequence runs xs through the net one timestep at a time, in
+// order, and returns each timestep's output volume. Any LayerRNN,
+// LayerGRU, or LayerLSTM in the net carries its hidden state from one
+// call to the next, the same way a single Forward call would if it were
+// repeated, so the sequence is processed as one unrolled recurrence. Call
+// ResetState first to start a fresh sequence rather than continuing one.
+// Pair with BackwardSequence to backprop-through-time over the whole
+// sequence at once.
+func (net *Net) ForwardSequence(xs []*Vol) []*Vol {
+	outs := make([]*Vol, len(xs))
+	for i, x := range xs {
+		outs[i] = net.Forward(x, true)
+		for _, l := range net.Layers {
+			l.(stepCache).pushState()
+		}
+	}
+	return outs
+}
+
+// BackwardSequence backpropagates ys, one per timestep most recently
+// passed to ForwardSequence, through the net in reverse time order,
+// accumulating every layer's weight gradients across the whole sequence.
+// It returns the total loss. Call it once per ForwardSequence call; it
+// consumes the state ForwardSequence pushed.
+func (net *Net) BackwardSequence(ys []LossData) float64 {
+	for _, l := range net.Layers {
+		if r, ok := l.(bpttResetter); ok {
+			r.resetBPTT()
+		}
+	}
+
+	var total float64
+	for t := len(ys) - 1; t >= 0; t-- {
+		for _, l := range net.Layers {
+			l.(stepCache).popState()
+		}
+
+		last := net.Layers[len(net.Layers)-1].(lossLayer)
+		total += last.BackwardLoss(ys[t])
+
+		for i := len(net.Layers) - 2; i >= 0; i-- {
+			net.Layers[i].Backward()
+		}
+	}
+	return total
+}
+
+// ResetState clears the hidden (and, for LSTM, cell) state carried by
+// every recurrent layer in net, so the next ForwardSequence call starts a
+// fresh sequence instead of continuing the previous one.
+func (net *Net) ResetState() {
+	for _, l := range net.Layers {
+		if r, ok := l.(recurrentLayer); ok {
+			r.ResetState()
+		}
+	}
+}
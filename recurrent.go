@@ -0,0 +1,557 @@
+package convnet
+
+import (
+	"math"
+	"math/rand"
+)
+
+// gate is one affine transform of this timestep's input and the previous
+// hidden state into a hiddenSize vector of pre-activations. LayerRNN has
+// one gate, LayerGRU has three, and LayerLSTM has four; each owns its own
+// gate so its weights train independently.
+type gate struct {
+	wx, wh []*Vol // hiddenSize vols: input-to-hidden and hidden-to-hidden weights
+	b      *Vol
+}
+
+func newGate(numInputs, hiddenSize int, std float64, r *rand.Rand) *gate {
+	g := &gate{
+		wx: make([]*Vol, hiddenSize),
+		wh: make([]*Vol, hiddenSize),
+		b:  NewVol(1, 1, hiddenSize, 0),
+	}
+	for i := 0; i < hiddenSize; i++ {
+		g.wx[i] = NewVolRand(1, 1, numInputs, std, r)
+		g.wh[i] = NewVolRand(1, 1, hiddenSize, std, r)
+	}
+	return g
+}
+
+// forward writes this gate's pre-activation sum for x and hPrev into dst.
+func (g *gate) forward(x, hPrev, dst []float64) {
+	for i := range dst {
+		sum := g.b.W[i]
+		for j, w := range g.wx[i].W {
+			sum += x[j] * w
+		}
+		for j, w := range g.wh[i].W {
+			sum += hPrev[j] * w
+		}
+		dst[i] = sum
+	}
+}
+
+// backward distributes d, the gradient on this gate's pre-activation sum,
+// onto dx and dhPrev and accumulates this gate's own weight gradients.
+func (g *gate) backward(x, hPrev, d, dx, dhPrev []float64) {
+	for i, gi := range d {
+		wx := g.wx[i]
+		for j, w := range wx.W {
+			dx[j] += w * gi
+			wx.Dw[j] += x[j] * gi
+		}
+		wh := g.wh[i]
+		for j, w := range wh.W {
+			dhPrev[j] += w * gi
+			wh.Dw[j] += hPrev[j] * gi
+		}
+		g.b.Dw[i] += gi
+	}
+}
+
+func (g *gate) paramsAndGrads(l1, l2 float64) []ParamsAndGrads {
+	pg := make([]ParamsAndGrads, 0, len(g.wx)+len(g.wh)+1)
+	for _, v := range g.wx {
+		pg = append(pg, ParamsAndGrads{Params: v, Grads: v, L1DecayMul: l1, L2DecayMul: l2})
+	}
+	for _, v := range g.wh {
+		pg = append(pg, ParamsAndGrads{Params: v, Grads: v, L1DecayMul: l1, L2DecayMul: l2})
+	}
+	pg = append(pg, ParamsAndGrads{Params: g.b, Grads: g.b, L1DecayMul: 0, L2DecayMul: 0})
+	return pg
+}
+
+func (g *gate) cloneShared() *gate {
+	clone := &gate{
+		wx: make([]*Vol, len(g.wx)),
+		wh: make([]*Vol, len(g.wh)),
+		b:  g.b.CloneShared(),
+	}
+	for i, v := range g.wx {
+		clone.wx[i] = v.CloneShared()
+	}
+	for i, v := range g.wh {
+		clone.wh[i] = v.CloneShared()
+	}
+	return clone
+}
+
+func sigmoid(x float64) float64 { return 1 / (1 + math.Exp(-x)) }
+
+// rnnLayer is a vanilla recurrent layer: h_t = tanh(Wxh*x_t + Whh*h_{t-1} + bh).
+type rnnLayer struct {
+	hiddenSize             int
+	inSx, inSy, inDepth    int
+	l1DecayMul, l2DecayMul float64
+
+	cell *gate
+
+	h      *Vol // hidden state as of the most recent Forward call
+	dhNext []float64
+
+	inAct, outAct *Vol
+	hPrev         *Vol
+
+	history []rnnState
+}
+
+type rnnState struct {
+	inAct, outAct, hPrev *Vol
+}
+
+func newRNNLayer(def LayerDef, r *rand.Rand) *rnnLayer {
+	if r == nil {
+		r = rand.New(rand.NewSource(0))
+	}
+	numInputs := def.OutSx * def.OutSy * def.OutDepth
+	l := &rnnLayer{
+		hiddenSize: def.HiddenSize,
+		inSx:       def.OutSx, inSy: def.OutSy, inDepth: def.OutDepth,
+		l1DecayMul: def.L1DecayMul, l2DecayMul: def.L2DecayMul,
+		cell: newGate(numInputs, def.HiddenSize, math.Sqrt(2.0/float64(numInputs)), r),
+	}
+	if l.l2DecayMul == 0 {
+		l.l2DecayMul = 1
+	}
+	return l
+}
+
+func (l *rnnLayer) Type() LayerType              { return LayerRNN }
+func (l *rnnLayer) OutputShape() (int, int, int) { return 1, 1, l.hiddenSize }
+
+func (l *rnnLayer) Forward(in *Vol, isTraining bool) *Vol {
+	l.inAct = in
+	if l.h == nil {
+		l.h = NewVol(1, 1, l.hiddenSize, 0)
+	}
+	l.hPrev = l.h
+
+	out := NewVol(1, 1, l.hiddenSize, 0)
+	l.cell.forward(in.W, l.hPrev.W, out.W)
+	for i := range out.W {
+		out.W[i] = math.Tanh(out.W[i])
+	}
+
+	l.h = out
+	l.outAct = out
+	return out
+}
+
+func (l *rnnLayer) Backward() {
+	in := l.inAct
+	in.ZeroGrads()
+
+	d := make([]float64, l.hiddenSize)
+	for i := range d {
+		dh := l.outAct.Dw[i]
+		if l.dhNext != nil {
+			dh += l.dhNext[i]
+		}
+		d[i] = dh * (1 - l.outAct.W[i]*l.outAct.W[i])
+	}
+
+	dhPrev := make([]float64, l.hiddenSize)
+	l.cell.backward(in.W, l.hPrev.W, d, in.Dw, dhPrev)
+	l.dhNext = dhPrev
+}
+
+func (l *rnnLayer) ResetState() {
+	l.h = nil
+	l.dhNext = nil
+	l.history = nil
+}
+
+func (l *rnnLayer) resetBPTT() { l.dhNext = nil }
+
+func (l *rnnLayer) ParamsAndGrads() []ParamsAndGrads {
+	return l.cell.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)
+}
+
+func (l *rnnLayer) cloneShared() Layer {
+	return &rnnLayer{
+		hiddenSize: l.hiddenSize,
+		inSx:       l.inSx, inSy: l.inSy, inDepth: l.inDepth,
+		l1DecayMul: l.l1DecayMul, l2DecayMul: l.l2DecayMul,
+		cell: l.cell.cloneShared(),
+	}
+}
+
+func (l *rnnLayer) pushState() {
+	l.history = append(l.history, rnnState{inAct: l.inAct, outAct: l.outAct, hPrev: l.hPrev})
+}
+
+func (l *rnnLayer) popState() {
+	n := len(l.history) - 1
+	s := l.history[n]
+	l.inAct, l.outAct, l.hPrev = s.inAct, s.outAct, s.hPrev
+	l.history = l.history[:n]
+}
+
+// gruLayer is a gated recurrent unit:
+//
+//	z_t = sigmoid(Wxz*x_t + Whz*h_{t-1} + bz)
+//	r_t = sigmoid(Wxr*x_t + Whr*h_{t-1} + br)
+//	g_t = tanh(Wxg*x_t + Whg*(r_t*h_{t-1}) + bg)
+//	h_t = (1-z_t)*h_{t-1} + z_t*g_t
+type gruLayer struct {
+	hiddenSize             int
+	inSx, inSy, inDepth    int
+	l1DecayMul, l2DecayMul float64
+
+	z, r, g *gate
+
+	h      *Vol
+	dhNext []float64
+
+	inAct, outAct    *Vol
+	hPrev            *Vol
+	zAct, rAct, gAct []float64
+	rh               []float64 // r_t * h_{t-1}, the value g.wh actually saw
+
+	history []gruState
+}
+
+type gruState struct {
+	inAct, outAct, hPrev *Vol
+	zAct, rAct, gAct, rh []float64
+}
+
+func newGRULayer(def LayerDef, r *rand.Rand) *gruLayer {
+	if r == nil {
+		r = rand.New(rand.NewSource(0))
+	}
+	numInputs := def.OutSx * def.OutSy * def.OutDepth
+	std := math.Sqrt(2.0 / float64(numInputs))
+	l := &gruLayer{
+		hiddenSize: def.HiddenSize,
+		inSx:       def.OutSx, inSy: def.OutSy, inDepth: def.OutDepth,
+		l1DecayMul: def.L1DecayMul, l2DecayMul: def.L2DecayMul,
+		z: newGate(numInputs, def.HiddenSize, std, r),
+		r: newGate(numInputs, def.HiddenSize, std, r),
+		g: newGate(numInputs, def.HiddenSize, std, r),
+	}
+	if l.l2DecayMul == 0 {
+		l.l2DecayMul = 1
+	}
+	return l
+}
+
+func (l *gruLayer) Type() LayerType              { return LayerGRU }
+func (l *gruLayer) OutputShape() (int, int, int) { return 1, 1, l.hiddenSize }
+
+func (l *gruLayer) Forward(in *Vol, isTraining bool) *Vol {
+	l.inAct = in
+	if l.h == nil {
+		l.h = NewVol(1, 1, l.hiddenSize, 0)
+	}
+	l.hPrev = l.h
+
+	n := l.hiddenSize
+	zAct := make([]float64, n)
+	rAct := make([]float64, n)
+	l.z.forward(in.W, l.hPrev.W, zAct)
+	l.r.forward(in.W, l.hPrev.W, rAct)
+	for i := range zAct {
+		zAct[i] = sigmoid(zAct[i])
+		rAct[i] = sigmoid(rAct[i])
+	}
+
+	rh := make([]float64, n)
+	for i := range rh {
+		rh[i] = rAct[i] * l.hPrev.W[i]
+	}
+	gAct := make([]float64, n)
+	l.g.forward(in.W, rh, gAct)
+	for i := range gAct {
+		gAct[i] = math.Tanh(gAct[i])
+	}
+
+	out := NewVol(1, 1, n, 0)
+	for i := range out.W {
+		out.W[i] = (1-zAct[i])*l.hPrev.W[i] + zAct[i]*gAct[i]
+	}
+
+	l.zAct, l.rAct, l.gAct, l.rh = zAct, rAct, gAct, rh
+	l.h = out
+	l.outAct = out
+	return out
+}
+
+func (l *gruLayer) Backward() {
+	in := l.inAct
+	in.ZeroGrads()
+
+	n := l.hiddenSize
+	dh := make([]float64, n)
+	for i := range dh {
+		dh[i] = l.outAct.Dw[i]
+		if l.dhNext != nil {
+			dh[i] += l.dhNext[i]
+		}
+	}
+
+	dz := make([]float64, n)
+	dg := make([]float64, n)
+	dhPrev := make([]float64, n)
+	for i := range dh {
+		dz[i] = dh[i] * (l.gAct[i] - l.hPrev.W[i]) * l.zAct[i] * (1 - l.zAct[i])
+		dg[i] = dh[i] * l.zAct[i] * (1 - l.gAct[i]*l.gAct[i])
+		dhPrev[i] = dh[i] * (1 - l.zAct[i])
+	}
+
+	drh := make([]float64, n)
+	l.g.backward(in.W, l.rh, dg, in.Dw, drh)
+
+	dr := make([]float64, n)
+	for i := range dr {
+		dr[i] = drh[i] * l.hPrev.W[i] * l.rAct[i] * (1 - l.rAct[i])
+		dhPrev[i] += drh[i] * l.rAct[i]
+	}
+
+	l.z.backward(in.W, l.hPrev.W, dz, in.Dw, dhPrev)
+	l.r.backward(in.W, l.hPrev.W, dr, in.Dw, dhPrev)
+
+	l.dhNext = dhPrev
+}
+
+func (l *gruLayer) ResetState() {
+	l.h = nil
+	l.dhNext = nil
+	l.history = nil
+}
+
+func (l *gruLayer) resetBPTT() { l.dhNext = nil }
+
+func (l *gruLayer) ParamsAndGrads() []ParamsAndGrads {
+	var pg []ParamsAndGrads
+	pg = append(pg, l.z.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	pg = append(pg, l.r.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	pg = append(pg, l.g.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	return pg
+}
+
+func (l *gruLayer) cloneShared() Layer {
+	return &gruLayer{
+		hiddenSize: l.hiddenSize,
+		inSx:       l.inSx, inSy: l.inSy, inDepth: l.inDepth,
+		l1DecayMul: l.l1DecayMul, l2DecayMul: l.l2DecayMul,
+		z: l.z.cloneShared(), r: l.r.cloneShared(), g: l.g.cloneShared(),
+	}
+}
+
+func (l *gruLayer) pushState() {
+	l.history = append(l.history, gruState{
+		inAct: l.inAct, outAct: l.outAct, hPrev: l.hPrev,
+		zAct: l.zAct, rAct: l.rAct, gAct: l.gAct, rh: l.rh,
+	})
+}
+
+func (l *gruLayer) popState() {
+	n := len(l.history) - 1
+	s := l.history[n]
+	l.inAct, l.outAct, l.hPrev = s.inAct, s.outAct, s.hPrev
+	l.zAct, l.rAct, l.gAct, l.rh = s.zAct, s.rAct, s.gAct, s.rh
+	l.history = l.history[:n]
+}
+
+// lstmLayer is a standard LSTM cell:
+//
+//	i_t = sigmoid(Wxi*x_t + Whi*h_{t-1} + bi)
+//	f_t = sigmoid(Wxf*x_t + Whf*h_{t-1} + bf)
+//	o_t = sigmoid(Wxo*x_t + Who*h_{t-1} + bo)
+//	g_t = tanh(Wxg*x_t + Whg*h_{t-1} + bg)
+//	c_t = f_t*c_{t-1} + i_t*g_t
+//	h_t = o_t*tanh(c_t)
+type lstmLayer struct {
+	hiddenSize             int
+	inSx, inSy, inDepth    int
+	l1DecayMul, l2DecayMul float64
+
+	i, f, o, g *gate
+
+	h, c   *Vol
+	dhNext []float64
+	dcNext []float64
+
+	inAct, outAct          *Vol
+	hPrev, cPrev           *Vol
+	iAct, fAct, oAct, gAct []float64
+	cAct, tanhCAct         []float64
+
+	history []lstmState
+}
+
+type lstmState struct {
+	inAct, outAct, hPrev, cPrev *Vol
+	iAct, fAct, oAct, gAct      []float64
+	cAct, tanhCAct              []float64
+}
+
+func newLSTMLayer(def LayerDef, r *rand.Rand) *lstmLayer {
+	if r == nil {
+		r = rand.New(rand.NewSource(0))
+	}
+	numInputs := def.OutSx * def.OutSy * def.OutDepth
+	std := math.Sqrt(2.0 / float64(numInputs))
+	l := &lstmLayer{
+		hiddenSize: def.HiddenSize,
+		inSx:       def.OutSx, inSy: def.OutSy, inDepth: def.OutDepth,
+		l1DecayMul: def.L1DecayMul, l2DecayMul: def.L2DecayMul,
+		i: newGate(numInputs, def.HiddenSize, std, r),
+		f: newGate(numInputs, def.HiddenSize, std, r),
+		o: newGate(numInputs, def.HiddenSize, std, r),
+		g: newGate(numInputs, def.HiddenSize, std, r),
+	}
+	if l.l2DecayMul == 0 {
+		l.l2DecayMul = 1
+	}
+	return l
+}
+
+func (l *lstmLayer) Type() LayerType              { return LayerLSTM }
+func (l *lstmLayer) OutputShape() (int, int, int) { return 1, 1, l.hiddenSize }
+
+func (l *lstmLayer) Forward(in *Vol, isTraining bool) *Vol {
+	l.inAct = in
+	if l.h == nil {
+		l.h = NewVol(1, 1, l.hiddenSize, 0)
+		l.c = NewVol(1, 1, l.hiddenSize, 0)
+	}
+	l.hPrev, l.cPrev = l.h, l.c
+
+	n := l.hiddenSize
+	iAct := make([]float64, n)
+	fAct := make([]float64, n)
+	oAct := make([]float64, n)
+	gAct := make([]float64, n)
+	l.i.forward(in.W, l.hPrev.W, iAct)
+	l.f.forward(in.W, l.hPrev.W, fAct)
+	l.o.forward(in.W, l.hPrev.W, oAct)
+	l.g.forward(in.W, l.hPrev.W, gAct)
+	for idx := range iAct {
+		iAct[idx] = sigmoid(iAct[idx])
+		fAct[idx] = sigmoid(fAct[idx])
+		oAct[idx] = sigmoid(oAct[idx])
+		gAct[idx] = math.Tanh(gAct[idx])
+	}
+
+	cAct := make([]float64, n)
+	tanhCAct := make([]float64, n)
+	out := NewVol(1, 1, n, 0)
+	for idx := range cAct {
+		cAct[idx] = fAct[idx]*l.cPrev.W[idx] + iAct[idx]*gAct[idx]
+		tanhCAct[idx] = math.Tanh(cAct[idx])
+		out.W[idx] = oAct[idx] * tanhCAct[idx]
+	}
+
+	l.iAct, l.fAct, l.oAct, l.gAct = iAct, fAct, oAct, gAct
+	l.cAct, l.tanhCAct = cAct, tanhCAct
+
+	l.h = out
+	l.c = NewVol(1, 1, n, 0)
+	copy(l.c.W, cAct)
+	l.outAct = out
+	return out
+}
+
+func (l *lstmLayer) Backward() {
+	in := l.inAct
+	in.ZeroGrads()
+
+	n := l.hiddenSize
+	dh := make([]float64, n)
+	for idx := range dh {
+		dh[idx] = l.outAct.Dw[idx]
+		if l.dhNext != nil {
+			dh[idx] += l.dhNext[idx]
+		}
+	}
+
+	dc := make([]float64, n)
+	for idx := range dc {
+		dc[idx] = dh[idx] * l.oAct[idx] * (1 - l.tanhCAct[idx]*l.tanhCAct[idx])
+		if l.dcNext != nil {
+			dc[idx] += l.dcNext[idx]
+		}
+	}
+
+	di := make([]float64, n)
+	df := make([]float64, n)
+	do := make([]float64, n)
+	dg := make([]float64, n)
+	dcPrev := make([]float64, n)
+	for idx := range dc {
+		do[idx] = dh[idx] * l.tanhCAct[idx] * l.oAct[idx] * (1 - l.oAct[idx])
+		di[idx] = dc[idx] * l.gAct[idx] * l.iAct[idx] * (1 - l.iAct[idx])
+		df[idx] = dc[idx] * l.cPrev.W[idx] * l.fAct[idx] * (1 - l.fAct[idx])
+		dg[idx] = dc[idx] * l.iAct[idx] * (1 - l.gAct[idx]*l.gAct[idx])
+		dcPrev[idx] = dc[idx] * l.fAct[idx]
+	}
+
+	dhPrev := make([]float64, n)
+	l.i.backward(in.W, l.hPrev.W, di, in.Dw, dhPrev)
+	l.f.backward(in.W, l.hPrev.W, df, in.Dw, dhPrev)
+	l.o.backward(in.W, l.hPrev.W, do, in.Dw, dhPrev)
+	l.g.backward(in.W, l.hPrev.W, dg, in.Dw, dhPrev)
+
+	l.dhNext = dhPrev
+	l.dcNext = dcPrev
+}
+
+func (l *lstmLayer) ResetState() {
+	l.h = nil
+	l.c = nil
+	l.dhNext = nil
+	l.dcNext = nil
+	l.history = nil
+}
+
+func (l *lstmLayer) resetBPTT() {
+	l.dhNext = nil
+	l.dcNext = nil
+}
+
+func (l *lstmLayer) ParamsAndGrads() []ParamsAndGrads {
+	var pg []ParamsAndGrads
+	pg = append(pg, l.i.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	pg = append(pg, l.f.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	pg = append(pg, l.o.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	pg = append(pg, l.g.paramsAndGrads(l.l1DecayMul, l.l2DecayMul)...)
+	return pg
+}
+
+func (l *lstmLayer) cloneShared() Layer {
+	return &lstmLayer{
+		hiddenSize: l.hiddenSize,
+		inSx:       l.inSx, inSy: l.inSy, inDepth: l.inDepth,
+		l1DecayMul: l.l1DecayMul, l2DecayMul: l.l2DecayMul,
+		i: l.i.cloneShared(), f: l.f.cloneShared(), o: l.o.cloneShared(), g: l.g.cloneShared(),
+	}
+}
+
+func (l *lstmLayer) pushState() {
+	l.history = append(l.history, lstmState{
+		inAct: l.inAct, outAct: l.outAct, hPrev: l.hPrev, cPrev: l.cPrev,
+		iAct: l.iAct, fAct: l.fAct, oAct: l.oAct, gAct: l.gAct,
+		cAct: l.cAct, tanhCAct: l.tanhCAct,
+	})
+}
+
+func (l *lstmLayer) popState() {
+	n := len(l.history) - 1
+	s := l.history[n]
+	l.inAct, l.outAct, l.hPrev, l.cPrev = s.inAct, s.outAct, s.hPrev, s.cPrev
+	l.iAct, l.fAct, l.oAct, l.gAct = s.iAct, s.fAct, s.oAct, s.gAct
+	l.cAct, l.tanhCAct = s.cAct, s.tanhCAct
+	l.history = l.history[:n]
+}
@@ -0,0 +1,204 @@
+package convnet_test
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	"github.com/BenLubar/convnet"
+)
+
+// recurrentTypes lists every LayerType TestRecurrentGradient checks.
+var recurrentTypes = []struct {
+	name string
+	kind convnet.LayerType
+}{
+	{"RNN", convnet.LayerRNN},
+	{"GRU", convnet.LayerGRU},
+	{"LSTM", convnet.LayerLSTM},
+}
+
+// it should compute correct single-step gradients for every recurrent
+// layer type, the same way TestGradient does for the feed-forward layers
+func TestRecurrentGradient(t *testing.T) {
+	for _, rt := range recurrentTypes {
+		rt := rt
+		t.Run(rt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			net := &convnet.Net{}
+			net.MakeLayers([]convnet.LayerDef{
+				{Type: convnet.LayerInput, OutSx: 1, OutSy: 1, OutDepth: 3},
+				{Type: rt.kind, HiddenSize: 4},
+				{Type: convnet.LayerSoftmax, NumClasses: 2},
+			}, r)
+
+			x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1, r.Float64()*2 - 1})
+			gti := r.Intn(2)
+
+			results := convnet.CheckGradients(net, x, convnet.LossData{Dim: gti}, convnet.CheckOptions{CheckParams: true})
+			for _, res := range results {
+				if !res.Pass {
+					t.Errorf("layer %d[%d]: rel error too high (%f)", res.Layer, res.Index, res.RelError)
+				}
+			}
+		})
+	}
+}
+
+// it should compute correct gradients across a whole sequence for every
+// recurrent layer type, checking the accumulated BPTT weight gradient
+// (not just a single timestep, the way TestRecurrentGradient does) against
+// a numeric estimate of the sequence loss's derivative.
+func TestRecurrentSequenceGradient(t *testing.T) {
+	const (
+		seqLen = 4
+		delta  = 1e-6
+		toler  = 1e-2
+	)
+
+	for _, rt := range recurrentTypes {
+		rt := rt
+		t.Run(rt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			net := &convnet.Net{}
+			net.MakeLayers([]convnet.LayerDef{
+				{Type: convnet.LayerInput, OutSx: 1, OutSy: 1, OutDepth: 3},
+				{Type: rt.kind, HiddenSize: 4},
+				{Type: convnet.LayerSoftmax, NumClasses: 2},
+			}, r)
+
+			xs := make([]*convnet.Vol, seqLen)
+			ys := make([]convnet.LossData, seqLen)
+			for i := range xs {
+				xs[i] = convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1, r.Float64()*2 - 1})
+				ys[i] = convnet.LossData{Dim: r.Intn(2)}
+			}
+
+			seqLoss := func() float64 {
+				net.ResetState()
+				var total float64
+				for i, x := range xs {
+					total += net.CostLoss(x, ys[i])
+				}
+				return total
+			}
+
+			net.ResetState()
+			net.ForwardSequence(xs)
+			net.BackwardSequence(ys)
+
+			for _, p := range net.ParamsAndGrads() {
+				for i := range p.Params.W {
+					analytic := p.Params.Dw[i]
+					old := p.Params.W[i]
+
+					p.Params.W[i] = old + delta
+					c0 := seqLoss()
+					p.Params.W[i] = old - delta
+					c1 := seqLoss()
+					p.Params.W[i] = old
+
+					numeric := (c0 - c1) / (2 * delta)
+					relError := math.Abs(analytic-numeric) / math.Max(math.Abs(analytic)+math.Abs(numeric), 1e-8)
+					if relError >= toler {
+						t.Errorf("param[%d]: analytic %f, numeric %f, rel error %f", i, analytic, numeric, relError)
+					}
+				}
+			}
+		})
+	}
+}
+
+// charRNNCorpus is the training text for TestCharLanguageModel, the same
+// kind of toy example karpathy/char-rnn ships with ConvNetJS: a net that
+// learns to predict the next character of a short, fixed string well
+// enough to reproduce it when sampled greedily.
+const charRNNCorpus = "hello world"
+
+// it should learn to predict the next character of a short fixed string,
+// the char-level language-model task ConvNetJS's karpathy/char-rnn demo
+// performs, for every recurrent layer type
+func TestCharLanguageModel(t *testing.T) {
+	vocab := make(map[byte]int)
+	var chars []byte
+	for i := 0; i < len(charRNNCorpus); i++ {
+		c := charRNNCorpus[i]
+		if _, ok := vocab[c]; !ok {
+			vocab[c] = len(chars)
+			chars = append(chars, c)
+		}
+	}
+
+	oneHot := func(c byte) *convnet.Vol {
+		w := make([]float64, len(chars))
+		w[vocab[c]] = 1
+		return convnet.NewVol1D(w)
+	}
+
+	for _, rt := range recurrentTypes {
+		rt := rt
+		t.Run(rt.name, func(t *testing.T) {
+			r := rand.New(rand.NewSource(0))
+			net := &convnet.Net{}
+			net.MakeLayers([]convnet.LayerDef{
+				{Type: convnet.LayerInput, OutSx: 1, OutSy: 1, OutDepth: len(chars)},
+				{Type: rt.kind, HiddenSize: 16},
+				{Type: convnet.LayerSoftmax, NumClasses: len(chars)},
+			}, r)
+
+			trainer := convnet.NewTrainer(net, convnet.TrainerOptions{
+				Method:       convnet.Adam,
+				LearningRate: 0.01,
+			})
+
+			xs := make([]*convnet.Vol, len(charRNNCorpus)-1)
+			ys := make([]convnet.LossData, len(charRNNCorpus)-1)
+			for i := range xs {
+				xs[i] = oneHot(charRNNCorpus[i])
+				ys[i] = convnet.LossData{Dim: vocab[charRNNCorpus[i+1]]}
+			}
+
+			lossAt := func() float64 {
+				net.ResetState()
+				var total float64
+				for i, x := range xs {
+					total += net.CostLoss(x, ys[i])
+				}
+				return total
+			}
+
+			before := lossAt()
+			for epoch := 0; epoch < 300; epoch++ {
+				net.ResetState()
+				trainer.TrainSequence(xs, ys)
+			}
+			after := lossAt()
+
+			if after >= before {
+				t.Fatalf("expected loss to decrease, but it changed from %f to %f", before, after)
+			}
+
+			// greedily sample from the trained net and check it
+			// reproduces the corpus it memorized.
+			net.ResetState()
+			var got []byte
+			in := charRNNCorpus[0]
+			got = append(got, in)
+			for i := 0; i < len(charRNNCorpus)-1; i++ {
+				pv := net.Forward(oneHot(in), false)
+				best, bestP := 0, pv.W[0]
+				for j, p := range pv.W {
+					if p > bestP {
+						best, bestP = j, p
+					}
+				}
+				in = chars[best]
+				got = append(got, in)
+			}
+
+			if string(got) != charRNNCorpus {
+				t.Errorf("expected sampled output %q to match memorized corpus %q", got, charRNNCorpus)
+			}
+		})
+	}
+}
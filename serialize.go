@@ -0,0 +1,160 @@
+package convnet
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+)
+
+// binaryMagic identifies a convnet binary model file.
+const binaryMagic = "CNET"
+
+// binaryVersion is bumped whenever the on-disk layout of Save/Load changes.
+const binaryVersion = 1
+
+// Save writes net to w in a compact little-endian binary format: a short
+// header (magic + version) followed by the JSON-encoded layer definitions
+// and then every learnable parameter volume, streamed as float64s. It is
+// intended for large nets where re-encoding weights as text would be slow
+// and wasteful; see MarshalJSON for an interchange-friendly alternative.
+func (net *Net) Save(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+
+	if _, err := io.WriteString(bw, binaryMagic); err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint32(binaryVersion)); err != nil {
+		return err
+	}
+
+	doc := jsonNet{Layers: make([]jsonLayer, len(net.Layers))}
+	for i, l := range net.Layers {
+		jl := layerToJSON(l)
+		jl.Filters = nil
+		jl.Biases = nil
+		doc.Layers[i] = jl
+	}
+	header, err := json.Marshal(doc)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(bw, binary.LittleEndian, uint64(len(header))); err != nil {
+		return err
+	}
+	if _, err := bw.Write(header); err != nil {
+		return err
+	}
+
+	for _, l := range net.Layers {
+		pg, ok := l.(learnable)
+		if !ok {
+			continue
+		}
+		for _, p := range pg.ParamsAndGrads() {
+			if err := writeVolWeights(bw, p.Params); err != nil {
+				return err
+			}
+		}
+	}
+
+	return bw.Flush()
+}
+
+// Load reads a net previously written by Save. The layer stack is rebuilt
+// before weights are overlaid, so Load must be called on a freshly zeroed
+// *Net.
+func (net *Net) Load(r io.Reader) error {
+	br := bufio.NewReader(r)
+
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(br, magic); err != nil {
+		return err
+	}
+	if string(magic) != binaryMagic {
+		return fmt.Errorf("convnet: bad binary header %q", magic)
+	}
+
+	var version uint32
+	if err := binary.Read(br, binary.LittleEndian, &version); err != nil {
+		return err
+	}
+	if version != binaryVersion {
+		return fmt.Errorf("convnet: unsupported binary version %d", version)
+	}
+
+	var headerLen uint64
+	if err := binary.Read(br, binary.LittleEndian, &headerLen); err != nil {
+		return err
+	}
+	header := make([]byte, headerLen)
+	if _, err := io.ReadFull(br, header); err != nil {
+		return err
+	}
+	var doc jsonNet
+	if err := json.Unmarshal(header, &doc); err != nil {
+		return err
+	}
+	layers := make([]Layer, len(doc.Layers))
+	for i, jl := range doc.Layers {
+		l, err := layerFromJSON(jl)
+		if err != nil {
+			return err
+		}
+		layers[i] = l
+	}
+	net.Layers = layers
+
+	for _, l := range net.Layers {
+		pg, ok := l.(learnable)
+		if !ok {
+			continue
+		}
+		for _, p := range pg.ParamsAndGrads() {
+			if err := readVolWeights(br, p.Params); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func writeVolWeights(w io.Writer, v *Vol) error {
+	if err := binary.Write(w, binary.LittleEndian, uint64(len(v.W))); err != nil {
+		return err
+	}
+	buf := make([]byte, 8*len(v.W))
+	for i, f := range v.W {
+		binary.LittleEndian.PutUint64(buf[i*8:], math.Float64bits(f))
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+func readVolWeights(r io.Reader, v *Vol) error {
+	var n uint64
+	if err := binary.Read(r, binary.LittleEndian, &n); err != nil {
+		return err
+	}
+	if int(n) != len(v.W) {
+		return fmt.Errorf("convnet: weight count mismatch: file has %d, layer expects %d", n, len(v.W))
+	}
+	buf := make([]byte, 8*n)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return err
+	}
+	for i := range v.W {
+		v.W[i] = math.Float64frombits(binary.LittleEndian.Uint64(buf[i*8:]))
+	}
+	return nil
+}
+
+// learnable is implemented by every layer that exposes trainable
+// parameters. It mirrors the per-layer bookkeeping the Trainer already
+// relies on.
+type learnable interface {
+	ParamsAndGrads() []ParamsAndGrads
+}
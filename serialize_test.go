@@ -0,0 +1,143 @@
+package convnet_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"math/rand"
+	"testing"
+
+	"github.com/BenLubar/convnet"
+)
+
+// it should produce identical Forward output after a binary Save/Load round-trip
+func TestSaveLoadRoundTrip(t *testing.T) {
+	net, trainer, r := createTestNet()
+
+	for k := 0; k < 20; k++ {
+		x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+		trainer.Train(x, convnet.LossData{Dim: r.Intn(3)})
+	}
+
+	x := convnet.NewVol1D([]float64{0.2, -0.3})
+	want := net.Forward(x, false)
+
+	var buf bytes.Buffer
+	if err := net.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded := &convnet.Net{}
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	got := loaded.Forward(x, false)
+	for i := range want.W {
+		if got.W[i] != want.W[i] {
+			t.Errorf("output[%d]: expected %f, got %f", i, want.W[i], got.W[i])
+		}
+	}
+}
+
+// it should produce identical Forward output after a binary Save/Load
+// round-trip for a net containing a recurrent layer
+func TestSaveLoadRoundTripLSTM(t *testing.T) {
+	r := rand.New(rand.NewSource(0))
+	net := &convnet.Net{}
+	net.MakeLayers([]convnet.LayerDef{
+		{Type: convnet.LayerInput, OutSx: 1, OutSy: 1, OutDepth: 2},
+		{Type: convnet.LayerLSTM, HiddenSize: 4},
+		{Type: convnet.LayerSoftmax, NumClasses: 3},
+	}, r)
+
+	var buf bytes.Buffer
+	if err := net.Save(&buf); err != nil {
+		t.Fatalf("Save: %v", err)
+	}
+
+	loaded := &convnet.Net{}
+	if err := loaded.Load(&buf); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+
+	x := convnet.NewVol1D([]float64{0.2, -0.3})
+	want := net.Forward(x, false)
+	got := loaded.Forward(x, false)
+	for i := range want.W {
+		if got.W[i] != want.W[i] {
+			t.Errorf("output[%d]: expected %f, got %f", i, want.W[i], got.W[i])
+		}
+	}
+}
+
+// it should split an fc layer's filters and bias vol the way ConvNetJS's
+// own toJSON does, rather than folding the bias into the filters array
+func TestMarshalJSONFCLayerSchema(t *testing.T) {
+	net, _, _ := createTestNet()
+
+	data, err := json.Marshal(net)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	var doc struct {
+		Layers []struct {
+			LayerType  string `json:"layer_type"`
+			NumNeurons int    `json:"num_neurons"`
+			Filters    []struct {
+				W []float64 `json:"w"`
+			} `json:"filters"`
+			Biases *struct {
+				Depth int `json:"depth"`
+			} `json:"biases"`
+		} `json:"layers"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		t.Fatalf("Unmarshal: %v", err)
+	}
+
+	for _, jl := range doc.Layers {
+		if jl.LayerType != "fc" {
+			continue
+		}
+		if len(jl.Filters) != jl.NumNeurons {
+			t.Errorf("fc layer: expected %d filters, got %d", jl.NumNeurons, len(jl.Filters))
+		}
+		if jl.Biases == nil {
+			t.Fatal("fc layer: expected a biases field, got none")
+		}
+		if jl.Biases.Depth != jl.NumNeurons {
+			t.Errorf("fc layer: expected biases depth %d, got %d", jl.NumNeurons, jl.Biases.Depth)
+		}
+	}
+}
+
+// it should produce identical Forward output after a JSON round-trip
+func TestMarshalUnmarshalJSONRoundTrip(t *testing.T) {
+	net, trainer, r := createTestNet()
+
+	for k := 0; k < 20; k++ {
+		x := convnet.NewVol1D([]float64{r.Float64()*2 - 1, r.Float64()*2 - 1})
+		trainer.Train(x, convnet.LossData{Dim: r.Intn(3)})
+	}
+
+	x := convnet.NewVol1D([]float64{0.2, -0.3})
+	want := net.Forward(x, false)
+
+	data, err := json.Marshal(net)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+
+	loaded, err := convnet.LoadFromJSON(data)
+	if err != nil {
+		t.Fatalf("LoadFromJSON: %v", err)
+	}
+
+	got := loaded.Forward(x, false)
+	for i := range want.W {
+		if got.W[i] != want.W[i] {
+			t.Errorf("output[%d]: expected %f, got %f", i, want.W[i], got.W[i])
+		}
+	}
+}
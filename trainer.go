@@ -0,0 +1,195 @@
+package convnet
+
+import "math"
+
+// Method selects the per-parameter update rule a Trainer applies.
+type Method int
+
+// The optimization methods a Trainer can use. SGD, the zero value, is
+// plain (optionally L1/L2-regularized) gradient descent; Momentum adds a
+// velocity term to it.
+const (
+	SGD Method = iota
+	Momentum
+	Nesterov
+	AdaGrad
+	RMSProp
+	Adadelta
+	Adam
+)
+
+// Default hyperparameters for the adaptive methods, matching the values
+// recommended in the papers that introduced them.
+const (
+	defaultBeta1 = 0.9
+	defaultBeta2 = 0.999
+	defaultEps   = 1e-8
+	defaultRho   = 0.99
+)
+
+// TrainerOptions configures a Trainer.
+type TrainerOptions struct {
+	Method Method
+
+	LearningRate float64
+	Momentum     float64
+	BatchSize    int
+	L2Decay      float64
+	L1Decay      float64
+
+	// Beta1, Beta2, and Eps configure Adam; Eps is also used by AdaGrad,
+	// RMSProp, and Adadelta. Rho configures RMSProp and Adadelta. Zero
+	// means "use the method's recommended default".
+	Beta1, Beta2, Eps, Rho float64
+}
+
+// Trainer applies gradient-descent updates to a Net's learnable
+// parameters after each Backward pass.
+type Trainer struct {
+	net  *Net
+	opts TrainerOptions
+
+	k int // number of Train calls seen so far, used to batch updates
+	t int // Adam timestep (number of updates applied so far)
+
+	// state holds one entry per parameter returned by paramsAndGrads,
+	// allocated lazily on the first update so plain SGD pays nothing for
+	// methods it doesn't use.
+	state []*optimState
+}
+
+// optimState is the per-parameter memory an adaptive method accumulates
+// across updates. Which fields are used depends on Trainer.opts.Method.
+type optimState struct {
+	gsum []float64 // velocity (Momentum, Nesterov) or gradient accumulator (AdaGrad, RMSProp, Adadelta)
+	xsum []float64 // accumulated update magnitude, for Adadelta
+	m, v []float64 // first/second moment estimates, for Adam
+}
+
+// NewTrainer returns a Trainer that will update net's parameters
+// according to opts.
+func NewTrainer(net *Net, opts TrainerOptions) *Trainer {
+	if opts.BatchSize == 0 {
+		opts.BatchSize = 1
+	}
+	if opts.Beta1 == 0 {
+		opts.Beta1 = defaultBeta1
+	}
+	if opts.Beta2 == 0 {
+		opts.Beta2 = defaultBeta2
+	}
+	if opts.Eps == 0 {
+		opts.Eps = defaultEps
+	}
+	if opts.Rho == 0 {
+		opts.Rho = defaultRho
+	}
+	return &Trainer{net: net, opts: opts}
+}
+
+// Train runs one example through the net, accumulates its gradient, and
+// every BatchSize calls applies a single parameter update. It returns the
+// loss for this example.
+func (t *Trainer) Train(x *Vol, y LossData) float64 {
+	loss := t.net.Backward(x, y)
+
+	t.k++
+	if t.k%t.opts.BatchSize == 0 {
+		t.update(t.opts.BatchSize)
+	}
+	return loss
+}
+
+func (t *Trainer) paramsAndGrads() []ParamsAndGrads {
+	return paramsOfNet(t.net)
+}
+
+// update applies one parameter step using whatever gradients are
+// currently accumulated in t.net's parameters, as though they came from
+// n examples, and then zeroes those gradients.
+func (t *Trainer) update(n int) {
+	all := t.paramsAndGrads()
+
+	if t.state == nil && t.opts.Method != SGD {
+		t.state = make([]*optimState, len(all))
+		for i, p := range all {
+			t.state[i] = &optimState{gsum: make([]float64, len(p.Params.W))}
+		}
+	}
+	t.t++
+
+	batchSize := float64(n)
+	for i, p := range all {
+		var s *optimState // stays nil for SGD, which keeps no state
+		if t.state != nil {
+			s = t.state[i]
+		}
+		for j := range p.Params.W {
+			g := p.Grads.Dw[j]/batchSize +
+				t.opts.L2Decay*p.L2DecayMul*p.Params.W[j] +
+				t.opts.L1Decay*p.L1DecayMul*math.Copysign(1, p.Params.W[j])
+
+			p.Params.W[j] += t.step(s, j, g)
+			p.Grads.Dw[j] = 0
+		}
+	}
+}
+
+// step computes the parameter delta for a single weight under the
+// trainer's configured Method, updating s in place.
+func (t *Trainer) step(s *optimState, j int, g float64) float64 {
+	lr, eps := t.opts.LearningRate, t.opts.Eps
+
+	switch t.opts.Method {
+	case Momentum:
+		s.gsum[j] = t.opts.Momentum*s.gsum[j] - lr*g
+		return s.gsum[j]
+
+	case Nesterov:
+		prev := s.gsum[j]
+		s.gsum[j] = t.opts.Momentum*prev - lr*g
+		return -t.opts.Momentum*prev + (1+t.opts.Momentum)*s.gsum[j]
+
+	case AdaGrad:
+		s.gsum[j] += g * g
+		return -lr * g / (math.Sqrt(s.gsum[j]) + eps)
+
+	case RMSProp:
+		rho := t.opts.Rho
+		s.gsum[j] = rho*s.gsum[j] + (1-rho)*g*g
+		return -lr * g / (math.Sqrt(s.gsum[j]) + eps)
+
+	case Adadelta:
+		t.ensureXsum(s)
+		rho := t.opts.Rho
+		s.gsum[j] = rho*s.gsum[j] + (1-rho)*g*g
+		dx := -math.Sqrt(s.xsum[j]+eps) / math.Sqrt(s.gsum[j]+eps) * g
+		s.xsum[j] = rho*s.xsum[j] + (1-rho)*dx*dx
+		return dx
+
+	case Adam:
+		t.ensureMV(s)
+		beta1, beta2 := t.opts.Beta1, t.opts.Beta2
+		s.m[j] = beta1*s.m[j] + (1-beta1)*g
+		s.v[j] = beta2*s.v[j] + (1-beta2)*g*g
+		mHat := s.m[j] / (1 - math.Pow(beta1, float64(t.t)))
+		vHat := s.v[j] / (1 - math.Pow(beta2, float64(t.t)))
+		return -lr * mHat / (math.Sqrt(vHat) + eps)
+
+	default: // SGD
+		return -lr * g
+	}
+}
+
+func (t *Trainer) ensureXsum(s *optimState) {
+	if s.xsum == nil {
+		s.xsum = make([]float64, len(s.gsum))
+	}
+}
+
+func (t *Trainer) ensureMV(s *optimState) {
+	if s.m == nil {
+		s.m = make([]float64, len(s.gsum))
+		s.v = make([]float64, len(s.gsum))
+	}
+}
@@ -0,0 +1,80 @@
+package convnet
+
+import "math/rand"
+
+// Vol is a 3-dimensional volume of numbers: the basic unit of data that
+// flows through a Net. W holds the activations and Dw holds the gradient
+// accumulated for them during Backward.
+type Vol struct {
+	Sx, Sy, Depth int
+	W, Dw         []float64
+}
+
+// NewVol returns a new Sx*Sy*Depth volume with every element initialized
+// to c.
+func NewVol(sx, sy, depth int, c float64) *Vol {
+	n := sx * sy * depth
+	v := &Vol{Sx: sx, Sy: sy, Depth: depth, W: make([]float64, n), Dw: make([]float64, n)}
+	if c != 0 {
+		for i := range v.W {
+			v.W[i] = c
+		}
+	}
+	return v
+}
+
+// NewVolRand returns a new Sx*Sy*Depth volume with every element drawn
+// independently from a normal distribution scaled by std.
+func NewVolRand(sx, sy, depth int, std float64, r *rand.Rand) *Vol {
+	v := NewVol(sx, sy, depth, 0)
+	for i := range v.W {
+		v.W[i] = r.NormFloat64() * std
+	}
+	return v
+}
+
+// NewVol1D returns a 1x1xlen(w) volume, the shape used for plain feature
+// vectors fed into the first LayerInput of a feed-forward net.
+func NewVol1D(w []float64) *Vol {
+	v := &Vol{Sx: 1, Sy: 1, Depth: len(w), W: make([]float64, len(w)), Dw: make([]float64, len(w))}
+	copy(v.W, w)
+	return v
+}
+
+// Get returns the activation at (x, y, d).
+func (v *Vol) Get(x, y, d int) float64 {
+	return v.W[((v.Sx*y)+x)*v.Depth+d]
+}
+
+// Set assigns the activation at (x, y, d).
+func (v *Vol) Set(x, y, d int, val float64) {
+	v.W[((v.Sx*y)+x)*v.Depth+d] = val
+}
+
+// AddGrad accumulates a gradient contribution at (x, y, d).
+func (v *Vol) AddGrad(x, y, d int, val float64) {
+	v.Dw[((v.Sx*y)+x)*v.Depth+d] += val
+}
+
+// ZeroGrads resets Dw to all zeroes, ready for the next Backward pass.
+func (v *Vol) ZeroGrads() {
+	for i := range v.Dw {
+		v.Dw[i] = 0
+	}
+}
+
+// CloneShared returns a Vol that aliases v's weights (W) but has its own
+// zeroed gradient buffer (Dw). It is how TrainParallel lets worker
+// goroutines read the same parameters concurrently while accumulating
+// their gradient contributions independently, free of data races.
+func (v *Vol) CloneShared() *Vol {
+	return &Vol{Sx: v.Sx, Sy: v.Sy, Depth: v.Depth, W: v.W, Dw: make([]float64, len(v.Dw))}
+}
+
+// Clone returns a deep copy of v.
+func (v *Vol) Clone() *Vol {
+	c := &Vol{Sx: v.Sx, Sy: v.Sy, Depth: v.Depth, W: make([]float64, len(v.W)), Dw: make([]float64, len(v.Dw))}
+	copy(c.W, v.W)
+	copy(c.Dw, v.Dw)
+	return c
+}